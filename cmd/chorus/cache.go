@@ -0,0 +1,104 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// Store is a pluggable backend for the content-addressable build cache.
+// DirStore (below) is the default, local-disk implementation; a team cache
+// (S3, HTTP) can be added later behind the same interface.
+type Store interface {
+	// GetOrCreate returns the artifact at key from the cache if present
+	// (hit=true). Otherwise it calls create to produce artifact on disk
+	// and saves it under key for future builds.
+	GetOrCreate(key, artifact string, create func() error) (hit bool, err error)
+	// Has reports whether key already has a cached artifact, without
+	// touching the filesystem target.
+	Has(key string) bool
+}
+
+// DirStore stores cached artifacts as plain files under root, named by
+// their content hash.
+type DirStore struct {
+	root string
+}
+
+func NewDirStore(root string) *DirStore {
+	return &DirStore{root: root}
+}
+
+func (d *DirStore) entryPath(key string) string {
+	return filepath.Join(d.root, key)
+}
+
+func (d *DirStore) Has(key string) bool {
+	_, err := os.Stat(d.entryPath(key))
+	return err == nil
+}
+
+// GetOrCreate restores or saves artifact, which may be either a single file
+// or a whole directory (e.g. a target whose cmds populate an output
+// directory); both are stored and restored as-is under the cache entry.
+func (d *DirStore) GetOrCreate(key, artifact string, create func() error) (bool, error) {
+	if d.Has(key) {
+		if err := os.MkdirAll(filepath.Dir(artifact), 0755); err != nil {
+			return false, err
+		}
+		if err := os.RemoveAll(artifact); err != nil {
+			return false, err
+		}
+		return true, copyPath(d.entryPath(key), artifact)
+	}
+
+	if err := create(); err != nil {
+		return false, err
+	}
+
+	if _, err := os.Stat(artifact); err != nil {
+		// Nothing to cache, e.g. a target whose commands don't leave a
+		// file at the target path.
+		return false, nil
+	}
+
+	if err := os.MkdirAll(d.root, 0755); err != nil {
+		return false, err
+	}
+	return false, copyPath(artifact, d.entryPath(key))
+}
+
+// cacheKey hashes everything that determines a target's output: its
+// expanded commands (which already bake in referenced ${VAR} values, except
+// the mtime-derived "${?}" - see expand) and the content of every declared
+// dependency file.
+func cacheKey(config *BuildConfig, target string, t Target) (string, error) {
+	h := sha256.New()
+
+	for _, cmd := range t.Cmds {
+		io.WriteString(h, expand(config, cmd, target, t, false))
+		io.WriteString(h, "\n")
+	}
+
+	for _, dep := range t.Deps {
+		data, err := os.ReadFile(dep)
+		if err != nil {
+			return "", fmt.Errorf("hashing dep %q: %w", dep, err)
+		}
+		sum := sha256.Sum256(data)
+		fmt.Fprintf(h, "%s:%x\n", dep, sum)
+	}
+
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+func printCacheHit(target string) {
+	fmt.Printf("%s %s %s\n\n",
+		green("✔"),
+		bold("Target"),
+		magenta(target)+green(" restored from cache!"),
+	)
+}
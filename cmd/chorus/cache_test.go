@@ -0,0 +1,140 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// TestDirStoreGetOrCreateRestoresMissingParentDir guards against a cache hit
+// failing on a fresh checkout/container, where the artifact's directory
+// (normally created by the now-skipped build command) doesn't exist yet.
+func TestDirStoreGetOrCreateRestoresMissingParentDir(t *testing.T) {
+	dir := t.TempDir()
+	cache := NewDirStore(filepath.Join(dir, "cache"))
+
+	created := false
+	artifact := filepath.Join(dir, "build", "obj", "foo.o")
+	create := func() error {
+		created = true
+		if err := os.MkdirAll(filepath.Dir(artifact), 0755); err != nil {
+			return err
+		}
+		return os.WriteFile(artifact, []byte("object"), 0644)
+	}
+
+	if _, err := cache.GetOrCreate("key", artifact, create); err != nil {
+		t.Fatalf("first GetOrCreate: %v", err)
+	}
+	if !created {
+		t.Fatal("expected create to run on cache miss")
+	}
+
+	if err := os.RemoveAll(filepath.Dir(artifact)); err != nil {
+		t.Fatalf("removing artifact dir: %v", err)
+	}
+
+	created = false
+	hit, err := cache.GetOrCreate("key", artifact, create)
+	if err != nil {
+		t.Fatalf("second GetOrCreate: %v", err)
+	}
+	if !hit {
+		t.Fatal("expected cache hit on second call")
+	}
+	if created {
+		t.Fatal("create should not run again on a cache hit")
+	}
+
+	if _, err := os.Stat(artifact); err != nil {
+		t.Fatalf("artifact not restored: %v", err)
+	}
+}
+
+// TestDirStoreGetOrCreateHandlesDirectoryArtifacts guards against a
+// directory-producing target (routine for C/Go builds) hard-failing the
+// build: GetOrCreate must cache and restore a whole output directory, not
+// just single files.
+func TestDirStoreGetOrCreateHandlesDirectoryArtifacts(t *testing.T) {
+	dir := t.TempDir()
+	cache := NewDirStore(filepath.Join(dir, "cache"))
+
+	artifact := filepath.Join(dir, "outdir")
+	create := func() error {
+		if err := os.MkdirAll(artifact, 0755); err != nil {
+			return err
+		}
+		return os.WriteFile(filepath.Join(artifact, "file.txt"), []byte("hi"), 0644)
+	}
+
+	if _, err := cache.GetOrCreate("dirkey", artifact, create); err != nil {
+		t.Fatalf("first GetOrCreate: %v", err)
+	}
+
+	if err := os.RemoveAll(artifact); err != nil {
+		t.Fatalf("removing artifact: %v", err)
+	}
+
+	hit, err := cache.GetOrCreate("dirkey", artifact, create)
+	if err != nil {
+		t.Fatalf("second GetOrCreate: %v", err)
+	}
+	if !hit {
+		t.Fatal("expected cache hit on second call")
+	}
+
+	got, err := os.ReadFile(filepath.Join(artifact, "file.txt"))
+	if err != nil {
+		t.Fatalf("restored file missing: %v", err)
+	}
+	if string(got) != "hi" {
+		t.Fatalf("restored file content = %q, want %q", got, "hi")
+	}
+}
+
+// TestCacheKeyStableAcrossMtimeOnlyChanges guards against the chunk0-3
+// review bug: cacheKey must not change when dep file content is identical
+// but mtime ordering differs (e.g. after a fresh checkout), since it's used
+// to decide cache hits across machines/checkouts where mtimes aren't
+// reliable.
+func TestCacheKeyStableAcrossMtimeOnlyChanges(t *testing.T) {
+	dir := t.TempDir()
+	depA := filepath.Join(dir, "a.txt")
+	depB := filepath.Join(dir, "b.txt")
+	target := filepath.Join(dir, "out.txt")
+
+	if err := os.WriteFile(depA, []byte("alpha"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(depB, []byte("beta"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(target, []byte("out"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	config := &BuildConfig{Variables: map[string]string{}}
+	tgt := Target{Deps: []string{depA, depB}, Cmds: []string{"cat ${?} > ${@}"}}
+
+	keyBefore, err := cacheKey(config, target, tgt)
+	if err != nil {
+		t.Fatalf("cacheKey: %v", err)
+	}
+
+	// Touch only depB's mtime, flipping which dep "${?}" (newer-than-target)
+	// would expand to, without changing any file's content.
+	future := time.Now().Add(time.Hour)
+	if err := os.Chtimes(depB, future, future); err != nil {
+		t.Fatal(err)
+	}
+
+	keyAfter, err := cacheKey(config, target, tgt)
+	if err != nil {
+		t.Fatalf("cacheKey: %v", err)
+	}
+
+	if keyBefore != keyAfter {
+		t.Fatalf("cacheKey changed on mtime-only difference: %q vs %q", keyBefore, keyAfter)
+	}
+}
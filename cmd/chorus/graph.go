@@ -0,0 +1,106 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+)
+
+// PlannedTarget is the JSON-serializable description of one resolved
+// target in the build graph, as produced by --graph and --dry-run.
+type PlannedTarget struct {
+	Name   string        `json:"name"`
+	Deps   []string      `json:"deps"`
+	Cmds   []string      `json:"cmds"`
+	Phony  bool          `json:"phony"`
+	Reason RebuildReason `json:"reason"`
+}
+
+// planGraph resolves the transitive dependency DAG for the given root
+// targets - following pattern rules where needed - without executing
+// anything, returning targets in dependency-first order.
+func planGraph(config *BuildConfig, cache *DirStore, roots []string) ([]*PlannedTarget, error) {
+	seen := map[string]*PlannedTarget{}
+	var order []*PlannedTarget
+
+	var visit func(name string) error
+	visit = func(name string) error {
+		if _, ok := seen[name]; ok {
+			return nil
+		}
+
+		t, exists := config.Targets[name]
+		if !exists && name != "all" {
+			pt, ok := resolvePattern(config, name)
+			if !ok {
+				return fmt.Errorf("target '%s' not defined", name)
+			}
+			t = pt
+		}
+
+		planned := &PlannedTarget{
+			Name:  name,
+			Deps:  t.Deps,
+			Cmds:  expandCmds(config, t, name),
+			Phony: t.Phony,
+		}
+		seen[name] = planned
+
+		for _, dep := range t.Deps {
+			if err := visit(dep); err != nil {
+				return err
+			}
+		}
+
+		// A real build updates a dep's mtime as soon as it rebuilds, which
+		// cascades into its own dependents; this planning-only traversal
+		// never actually runs anything, so it has to propagate that
+		// cascade explicitly instead of reading each target's current,
+		// stale mtime in isolation.
+		planned.Reason = needsRebuild(config, name, t, cache)
+		if planned.Reason == ReasonUpToDate {
+			for _, dep := range t.Deps {
+				if depPlanned, ok := seen[dep]; ok && depPlanned.Reason.rebuild() {
+					planned.Reason = ReasonDepRebuild
+					break
+				}
+			}
+		}
+
+		order = append(order, planned)
+		return nil
+	}
+
+	for _, root := range roots {
+		if err := visit(root); err != nil {
+			return nil, err
+		}
+	}
+
+	return order, nil
+}
+
+func expandCmds(config *BuildConfig, t Target, name string) []string {
+	expanded := make([]string, len(t.Cmds))
+	for i, cmd := range t.Cmds {
+		expanded[i] = expandVariables(config, cmd, name, t)
+	}
+	return expanded
+}
+
+func renderGraphJSON(targets []*PlannedTarget) error {
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	return enc.Encode(targets)
+}
+
+func renderGraphDot(targets []*PlannedTarget) {
+	fmt.Println("digraph chorus {")
+	for _, t := range targets {
+		fmt.Printf("  %q;\n", t.Name)
+		for _, dep := range t.Deps {
+			fmt.Printf("  %q -> %q;\n", t.Name, dep)
+		}
+	}
+	fmt.Println("}")
+}
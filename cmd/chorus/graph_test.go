@@ -0,0 +1,63 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// TestPlanGraphCascadesRebuildThroughDAG guards against the chunk0-6 review
+// bug: planGraph computed each target's RebuildReason from isolated,
+// current on-disk mtimes, so a target newer than its dep's *current* mtime
+// was reported up-to-date even though that dep is about to rebuild (and get
+// a fresh, newer mtime) once a real build runs - the exact cascade a real
+// `chorus` invocation performs.
+func TestPlanGraphCascadesRebuildThroughDAG(t *testing.T) {
+	dir := t.TempDir()
+	src := filepath.Join(dir, "src")
+	mid := filepath.Join(dir, "mid")
+	final := filepath.Join(dir, "final")
+
+	now := time.Now()
+	write := func(path string, mtime time.Time) {
+		if err := os.WriteFile(path, []byte("x"), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chtimes(path, mtime, mtime); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// mid is stale relative to src, but final is newer than mid's current
+	// (not-yet-rebuilt) mtime - the scenario a naive per-target mtime check
+	// gets wrong.
+	write(src, now)
+	write(mid, now.Add(-time.Hour))
+	write(final, now.Add(time.Minute))
+
+	config := &BuildConfig{
+		Variables: map[string]string{},
+		Targets: map[string]Target{
+			final: {Deps: []string{mid}},
+			mid:   {Deps: []string{src}},
+			src:   {},
+		},
+	}
+
+	planned, err := planGraph(config, nil, []string{final})
+	if err != nil {
+		t.Fatalf("planGraph: %v", err)
+	}
+
+	var finalReason RebuildReason
+	for _, p := range planned {
+		if p.Name == final {
+			finalReason = p.Reason
+		}
+	}
+
+	if !finalReason.rebuild() {
+		t.Fatalf("final plan reason = %q, want a rebuild reason (mid will rebuild and cascade)", finalReason)
+	}
+}
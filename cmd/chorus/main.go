@@ -1,12 +1,16 @@
 package main
 
 import (
+	"flag"
 	"fmt"
+	"io"
 	"log"
 	"os"
 	"os/exec"
 	"os/signal"
+	"path/filepath"
 	"regexp"
+	"runtime"
 	"strings"
 	"syscall"
 	"time"
@@ -26,20 +30,42 @@ var (
 	bold    = color.New(color.Bold).SprintFunc()
 )
 
+// Target describes a single buildable unit: the files it depends on, the
+// shell commands that produce it, and whether it should always run. A
+// literal target may also be synthesized from a pattern rule (e.g. "%.o:
+// %.c"), in which case Stem holds the bound "%".
+type Target struct {
+	Deps  []string `yaml:"deps"`
+	Cmds  []string `yaml:"cmds"`
+	Phony bool     `yaml:"phony"`
+	Stem  string   `yaml:"-"`
+}
+
 type BuildConfig struct {
 	Variables map[string]string `yaml:"variables"`
-	Targets   map[string]struct {
-		Deps     []string `yaml:"deps"`
-		Cmds     []string `yaml:"cmds"`
-		Phony    bool     `yaml:"phony"`
-		Executed bool
-	} `yaml:"targets"`
+	Targets   map[string]Target `yaml:"targets"`
 }
 
 func main() {
 	color.NoColor = false
+
+	jobs := flag.Int("j", runtime.NumCPU(), "number of targets to build in parallel")
+	shard := flag.Int("shard", 0, "index of this shard (0-based, used with --shards)")
+	shards := flag.Int("shards", 1, "total number of shards to split leaf/phony targets across")
+	noCache := flag.Bool("no-cache", false, "disable the content-addressable build cache")
+	dryRun := flag.Bool("dry-run", false, "print the expanded command sequence without executing it")
+	graphFormat := flag.String("graph", "", "emit the resolved dependency graph instead of building (json|dot)")
+	flag.Parse()
+
+	if *shard < 0 || *shards < 1 || *shard >= *shards {
+		exitWithError(fmt.Sprintf("invalid --shard %d for --shards %d", *shard, *shards))
+	}
+	if *graphFormat != "" && *graphFormat != "json" && *graphFormat != "dot" {
+		exitWithError(fmt.Sprintf("unknown --graph format %q (want json or dot)", *graphFormat))
+	}
+
 	startTime := time.Now()
-	
+
 	sigChan := make(chan os.Signal, 1)
 	signal.Notify(sigChan, os.Interrupt, syscall.SIGTERM)
 	go func() {
@@ -49,13 +75,42 @@ func main() {
 	}()
 
 	printHeader()
-	
-	if len(os.Args) < 2 {
-		processTarget(loadConfig(), "all")
-	} else {
-		config := loadConfig()
-		for _, arg := range os.Args[1:] {
-			processTarget(config, arg)
+
+	config := loadConfig()
+	targets := flag.Args()
+	if len(targets) == 0 {
+		targets = []string{"all"}
+	}
+
+	var cache *DirStore
+	if !*noCache {
+		cache = NewDirStore(".chorus-cache")
+	}
+
+	if *graphFormat != "" {
+		planned, err := planGraph(config, cache, targets)
+		if err != nil {
+			exitWithError("Error planning build graph:", err)
+		}
+		if *graphFormat == "dot" {
+			renderGraphDot(planned)
+		} else if err := renderGraphJSON(planned); err != nil {
+			exitWithError("Error rendering build graph:", err)
+		}
+		return
+	}
+
+	sched := newScheduler(config, *jobs)
+	sched.shard, sched.shards = *shard, *shards
+	sched.cache = cache
+	sched.dryRun = *dryRun
+	sched.roots = make(map[string]bool, len(targets))
+	for _, target := range targets {
+		sched.roots[target] = true
+	}
+	for _, target := range targets {
+		if err := sched.run(target); err != nil {
+			exitWithError("Build failed:", err)
 		}
 	}
 
@@ -92,132 +147,116 @@ func loadConfig() *BuildConfig {
 	return config
 }
 
-func processTarget(config *BuildConfig, target string) {
-	t, exists := config.Targets[target]
-	if !exists && target != "all" {
-		exitWithError(fmt.Sprintf("Target '%s' not defined", target))
-	}
-
-	if t.Executed {
-		return
-	}
-	t.Executed = true
-
-	for _, dep := range t.Deps {
-		processTarget(config, dep)
-	}
+// RebuildReason explains why a target either needs to run its commands or
+// can be skipped. It doubles as the planning output for --graph and
+// --dry-run.
+type RebuildReason string
+
+const (
+	ReasonUpToDate   RebuildReason = "up-to-date"
+	ReasonMissing    RebuildReason = "missing"
+	ReasonDepNewer   RebuildReason = "dep-newer"
+	ReasonPhony      RebuildReason = "phony"
+	ReasonCacheMiss  RebuildReason = "cache-miss"
+	ReasonDepRebuild RebuildReason = "dep-will-rebuild"
+)
 
-	if t.Phony || needsRebuild(target, t.Deps) {
-		executeCommands(config, t.Cmds, target)
-		printSuccess(target)
-	} else {
-		printSkipped(target)
-	}
+func (r RebuildReason) rebuild() bool {
+	return r != ReasonUpToDate
 }
 
-func needsRebuild(target string, deps []string) bool {
-	if target == "all" || strings.HasPrefix(target, "_") {
-		return true
+func needsRebuild(config *BuildConfig, target string, t Target, cache *DirStore) RebuildReason {
+	if t.Phony || target == "all" || strings.HasPrefix(target, "_") {
+		return ReasonPhony
 	}
 
 	info, err := os.Stat(target)
 	if os.IsNotExist(err) {
-		return true
+		return ReasonMissing
+	}
+
+	// With a cache available, trust its content hash over mtimes, which
+	// are unreliable after a fresh git checkout or in a container.
+	if cache != nil {
+		if key, err := cacheKey(config, target, t); err == nil {
+			if cache.Has(key) {
+				return ReasonUpToDate
+			}
+			return ReasonCacheMiss
+		}
 	}
 
 	targetTime := info.ModTime()
-	for _, dep := range deps {
+	for _, dep := range t.Deps {
 		depInfo, err := os.Stat(dep)
 		if err != nil {
-			return true
+			return ReasonMissing
 		}
 		if depInfo.ModTime().After(targetTime) {
-			return true
+			return ReasonDepNewer
 		}
 	}
-	return false
+	return ReasonUpToDate
 }
 
-func executeCommands(config *BuildConfig, cmds []string, target string) {
-	fmt.Printf("%s %s\n",
+// executeCommands runs t's commands against target, writing all progress
+// output (including spawned commands' stdout/stderr) to out rather than
+// directly to the terminal, so the scheduler can buffer it per target and
+// flush it atomically once the target finishes. When dryRun is set,
+// commands are expanded and written to out instead of being run.
+func executeCommands(config *BuildConfig, t Target, target string, out io.Writer, dryRun bool) error {
+	fmt.Fprintf(out, "%s %s\n",
 		cyan("●"),
 		bold("Processing target:")+" "+magenta(target),
 	)
-	
-	for _, cmd := range cmds {
+
+	for _, cmd := range t.Cmds {
 		if strings.HasPrefix(cmd, "internal:") {
-			handleInternalCommand(cmd)
+			if dryRun {
+				fmt.Fprintf(out, "  %s %s\n", blue("≡"), cyan(strings.TrimSpace(cmd)))
+				continue
+			}
+			if err := handleInternalCommand(config, t, target, cmd, out); err != nil {
+				return err
+			}
+			continue
+		}
+
+		cmd = expandVariables(config, cmd, target, t)
+
+		if dryRun {
+			fmt.Fprintf(out, "  %s %s\n", blue("≡"), cyan(strings.TrimSpace(cmd)))
 			continue
 		}
 
-		cmd = expandVariables(config, cmd, target)
 		start := time.Now()
-		
-		fmt.Printf("  %s %s\n",
+
+		fmt.Fprintf(out, "  %s %s\n",
 			blue("⌛"),
 			cyan(strings.TrimSpace(cmd)),
 		)
 
 		command := exec.Command("sh", "-c", cmd)
-		command.Stdout = os.Stdout
-		command.Stderr = os.Stderr
-		
+		command.Stdout = out
+		command.Stderr = out
+
 		if err := command.Run(); err != nil {
-			fmt.Printf("\r  %s %s %s\n",
+			fmt.Fprintf(out, "\r  %s %s %s\n",
 				red("✗"),
 				cyan(strings.TrimSpace(cmd)),
 				red(fmt.Sprintf("[FAIL] (%s)", time.Since(start).Round(time.Millisecond))),
 			)
-			exitWithError("Command failed:", err)
+			return fmt.Errorf("command failed: %w", err)
 		}
-		
-		fmt.Printf("\r  %s %s %s\n",
+
+		fmt.Fprintf(out, "\r  %s %s %s\n",
 			green("✓"),
 			cyan(strings.TrimSpace(cmd)),
 			green(fmt.Sprintf("[OK] (%s)", time.Since(start).Round(time.Millisecond))),
 		)
 	}
-}
-
-func handleInternalCommand(cmd string) {
-	start := time.Now()
-	cmdParts := strings.SplitN(cmd, ":", 2)
-	command := strings.TrimSpace(cmdParts[1])
-
-	fmt.Printf("  %s %s\n",
-		blue("⌛"),
-		cyan(command),
-	)
-
-	var err error
-	switch {
-	case strings.HasPrefix(command, "load_nvm"):
-		args := strings.Fields(command)
-		if len(args) < 2 {
-			err = fmt.Errorf("app file path required")
-		} else {
-			err = loadNVMHeader(args[1])
-		}
-	case strings.HasPrefix(command, "restore_nvm"):
-		err = restoreNVMHeader()
-	default:
-		err = fmt.Errorf("unknown internal command")
-	}
-
-	if err != nil {
-		fmt.Printf("\r  %s %s %s\n",
-			red("✗"),
-			cyan(command),
-			red(fmt.Sprintf("[FAIL] (%s)", time.Since(start).Round(time.Millisecond))),
-		)
-		exitWithError("Internal command failed:", err)
-	}
 
-	fmt.Printf("\r  %s %s %s\n",
-		green("✓"),
-		cyan(command),
-		green(fmt.Sprintf("[OK] (%s)", time.Since(start).Round(time.Millisecond))),
-	)
+	return nil
 }
 
 func loadNVMHeader(appFile string) error {
@@ -296,11 +335,58 @@ func copyFile(src, dst string) error {
 	return os.WriteFile(dst, input, 0644)
 }
 
-func expandVariables(config *BuildConfig, cmd string, target string) string {
+// copyPath copies src to dst, recursing into src if it's a directory. It's
+// the cache's restore/save primitive, since a target's artifact may be
+// either a single file or a whole output directory (routine for C/Go
+// builds).
+func copyPath(src, dst string) error {
+	info, err := os.Stat(src)
+	if err != nil {
+		return err
+	}
+	if !info.IsDir() {
+		return copyFile(src, dst)
+	}
+
+	if err := os.MkdirAll(dst, 0755); err != nil {
+		return err
+	}
+	entries, err := os.ReadDir(src)
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		if err := copyPath(filepath.Join(src, entry.Name()), filepath.Join(dst, entry.Name())); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// expandVariables substitutes ${VAR} references (both user-declared and the
+// automatic ones below) in cmd.
+func expandVariables(config *BuildConfig, cmd string, target string, t Target) string {
+	return expand(config, cmd, target, t, true)
+}
+
+// expand is expandVariables with the "${?}" automatic variable - the
+// mtime-derived "deps newer than target" list - made optional. The build
+// cache key (cacheKey, in cache.go) needs a content-stable expansion: "${?}"
+// reflects current mtimes, not file content, so hashing its expansion would
+// churn cache keys across machines/checkouts with identical dep content.
+// Callers that need that stability pass includeNewer=false and get "${?}"
+// back unexpanded.
+func expand(config *BuildConfig, cmd string, target string, t Target, includeNewer bool) string {
 	replacements := map[string]string{
-		"@": target,
-		"<": firstDependency(config, target),
-		"^": strings.Join(config.Targets[target].Deps, " "),
+		"@":  target,
+		"@D": filepath.Dir(target),
+		"@F": filepath.Base(target),
+		"<":  firstDependency(t),
+		"^":  strings.Join(t.Deps, " "),
+		"*":  t.Stem,
+	}
+	if includeNewer {
+		replacements["?"] = strings.Join(newerDeps(target, t.Deps), " ")
 	}
 
 	for k, v := range config.Variables {
@@ -314,13 +400,35 @@ func expandVariables(config *BuildConfig, cmd string, target string) string {
 	return cmd
 }
 
-func firstDependency(config *BuildConfig, target string) string {
-	if deps := config.Targets[target].Deps; len(deps) > 0 {
-		return deps[0]
+func firstDependency(t Target) string {
+	if len(t.Deps) > 0 {
+		return t.Deps[0]
 	}
 	return ""
 }
 
+// newerDeps returns the subset of deps whose mtime is after target's (or
+// all of them if target doesn't exist yet), for the "${?}" automatic
+// variable.
+func newerDeps(target string, deps []string) []string {
+	var targetTime time.Time
+	if info, err := os.Stat(target); err == nil {
+		targetTime = info.ModTime()
+	}
+
+	var newer []string
+	for _, dep := range deps {
+		depInfo, err := os.Stat(dep)
+		if err != nil {
+			continue
+		}
+		if depInfo.ModTime().After(targetTime) {
+			newer = append(newer, dep)
+		}
+	}
+	return newer
+}
+
 func printSuccess(target string) {
 	fmt.Printf("%s %s %s\n\n",
 		green("✔"),
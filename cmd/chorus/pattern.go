@@ -0,0 +1,72 @@
+package main
+
+import (
+	"sort"
+	"strings"
+)
+
+// resolvePattern looks for a pattern rule (e.g. "%.o: %.c") matching target
+// and, if one matches, synthesizes a concrete Target with the stem ("%")
+// substituted into its deps. When more than one rule matches (e.g. "%.o"
+// and "f%.o" both matching "foo.o"), the rule with the shortest stem wins,
+// mirroring make's most-specific-match precedence; remaining ties are
+// broken alphabetically by pattern name so the choice never depends on
+// config.Targets's (randomized) map iteration order.
+func resolvePattern(config *BuildConfig, target string) (Target, bool) {
+	type candidate struct {
+		name string
+		rule Target
+		stem string
+	}
+
+	var candidates []candidate
+	for name, rule := range config.Targets {
+		stem, ok := matchPattern(name, target)
+		if !ok {
+			continue
+		}
+		candidates = append(candidates, candidate{name, rule, stem})
+	}
+	if len(candidates) == 0 {
+		return Target{}, false
+	}
+
+	sort.Slice(candidates, func(i, j int) bool {
+		if len(candidates[i].stem) != len(candidates[j].stem) {
+			return len(candidates[i].stem) < len(candidates[j].stem)
+		}
+		return candidates[i].name < candidates[j].name
+	})
+
+	best := candidates[0]
+	deps := make([]string, len(best.rule.Deps))
+	for i, dep := range best.rule.Deps {
+		deps[i] = strings.ReplaceAll(dep, "%", best.stem)
+	}
+
+	return Target{Deps: deps, Cmds: best.rule.Cmds, Phony: best.rule.Phony, Stem: best.stem}, true
+}
+
+// matchPattern reports whether target matches pattern, a target name
+// containing a single "%" stem placeholder (e.g. "%.o"). On success it
+// returns the text "%" was bound to.
+func matchPattern(pattern, target string) (string, bool) {
+	star := strings.IndexByte(pattern, '%')
+	if star < 0 {
+		return "", false
+	}
+
+	prefix, suffix := pattern[:star], pattern[star+1:]
+	if len(target) < len(prefix)+len(suffix) {
+		return "", false
+	}
+	if !strings.HasPrefix(target, prefix) || !strings.HasSuffix(target, suffix) {
+		return "", false
+	}
+
+	stem := target[len(prefix) : len(target)-len(suffix)]
+	if stem == "" {
+		return "", false
+	}
+	return stem, true
+}
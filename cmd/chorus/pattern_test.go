@@ -0,0 +1,37 @@
+package main
+
+import "testing"
+
+// TestResolvePatternPrefersMostSpecificMatch guards against the nondeterministic
+// rule selection described in the chunk0-5 review: with both "%.o" and "f%.o"
+// matching "foo.o", the shorter-stem ("more specific") rule must win every time,
+// regardless of config.Targets's map iteration order.
+func TestResolvePatternPrefersMostSpecificMatch(t *testing.T) {
+	config := &BuildConfig{
+		Targets: map[string]Target{
+			"%.o":  {Cmds: []string{"cc -c %.c"}},
+			"f%.o": {Cmds: []string{"cc -special -c f%.c"}},
+		},
+	}
+
+	for i := 0; i < 20; i++ {
+		got, ok := resolvePattern(config, "foo.o")
+		if !ok {
+			t.Fatalf("resolvePattern: no match")
+		}
+		if got.Stem != "oo" {
+			t.Fatalf("resolvePattern picked stem %q, want %q (f%%.o should win over %%.o)", got.Stem, "oo")
+		}
+	}
+}
+
+// TestMatchPatternOverlongLiteralsDoNotMatch guards against a panic when a
+// pattern's literal prefix and suffix overlap for a shorter target (e.g.
+// "aba%a" against "aba"): the prefix/suffix checks can each pass on their
+// own while still leaving no room for a stem, which must report no match
+// instead of slicing out of bounds.
+func TestMatchPatternOverlongLiteralsDoNotMatch(t *testing.T) {
+	if _, ok := matchPattern("aba%a", "aba"); ok {
+		t.Fatal("expected no match when prefix+suffix is longer than target")
+	}
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// internalCommands is the registry of built-in "internal:" build steps.
+// Handlers are registered from init() so the registry is populated before
+// any build runs.
+var internalCommands = map[string]func(args []string) error{}
+
+// RegisterInternal adds a named internal command handler, invoked as
+// "internal:<name> <args...>" from a target's cmds.
+func RegisterInternal(name string, fn func(args []string) error) {
+	internalCommands[name] = fn
+}
+
+func init() {
+	RegisterInternal("load_nvm", func(args []string) error {
+		if len(args) < 1 {
+			return fmt.Errorf("app file path required")
+		}
+		return loadNVMHeader(args[0])
+	})
+	RegisterInternal("restore_nvm", func(args []string) error {
+		return restoreNVMHeader()
+	})
+}
+
+// pluginContext is the JSON payload piped to out-of-process plugins on
+// stdin, giving them the same build state available to internal commands.
+type pluginContext struct {
+	Variables map[string]string `json:"variables"`
+	Target    string            `json:"target"`
+	Deps      []string          `json:"deps"`
+}
+
+// handleInternalCommand dispatches an "internal:..." build step, either to
+// a handler registered via RegisterInternal or, for "internal:plugin:<name>",
+// to an out-of-process plugin binary.
+func handleInternalCommand(config *BuildConfig, t Target, target, cmd string, out io.Writer) error {
+	start := time.Now()
+	command := strings.TrimSpace(strings.SplitN(cmd, ":", 2)[1])
+
+	fmt.Fprintf(out, "  %s %s\n",
+		blue("⌛"),
+		cyan(command),
+	)
+
+	fields := strings.Fields(command)
+	var err error
+	switch {
+	case len(fields) == 0:
+		err = fmt.Errorf("empty internal command")
+	case strings.HasPrefix(fields[0], "plugin:"):
+		name := strings.TrimPrefix(fields[0], "plugin:")
+		err = runPlugin(config, t, target, name, fields[1:], out)
+	default:
+		fn, ok := internalCommands[fields[0]]
+		if !ok {
+			err = fmt.Errorf("unknown internal command %q", fields[0])
+		} else {
+			err = fn(fields[1:])
+		}
+	}
+
+	if err != nil {
+		fmt.Fprintf(out, "\r  %s %s %s\n",
+			red("✗"),
+			cyan(command),
+			red(fmt.Sprintf("[FAIL] (%s)", time.Since(start).Round(time.Millisecond))),
+		)
+		return fmt.Errorf("internal command failed: %w", err)
+	}
+
+	fmt.Fprintf(out, "\r  %s %s %s\n",
+		green("✓"),
+		cyan(command),
+		green(fmt.Sprintf("[OK] (%s)", time.Since(start).Round(time.Millisecond))),
+	)
+	return nil
+}
+
+// runPlugin execs an out-of-process plugin binary from
+// ~/.chorus/plugins/<name>, passing args on argv and the current build
+// context as JSON on stdin. This lets project-specific codegen steps be
+// shipped separately from chorus itself.
+func runPlugin(config *BuildConfig, t Target, target, name string, args []string, out io.Writer) error {
+	if name == "" || strings.ContainsAny(name, "/\\") || name == ".." {
+		return fmt.Errorf("invalid plugin name %q", name)
+	}
+
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return fmt.Errorf("resolving plugin directory: %w", err)
+	}
+
+	path := filepath.Join(home, ".chorus", "plugins", name)
+	if _, err := os.Stat(path); err != nil {
+		return fmt.Errorf("plugin %q not found at %s", name, path)
+	}
+
+	payload, err := json.Marshal(pluginContext{
+		Variables: config.Variables,
+		Target:    target,
+		Deps:      t.Deps,
+	})
+	if err != nil {
+		return fmt.Errorf("encoding plugin context: %w", err)
+	}
+
+	command := exec.Command(path, args...)
+	command.Stdin = bytes.NewReader(payload)
+	command.Stdout = out
+	command.Stderr = out
+	return command.Run()
+}
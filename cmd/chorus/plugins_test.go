@@ -0,0 +1,25 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+// TestRunPluginRejectsPathTraversal guards against the chunk0-4 review bug:
+// a plugin name taken verbatim from "internal:plugin:<name>" must not be
+// able to escape ~/.chorus/plugins via "/" or "..".
+func TestRunPluginRejectsPathTraversal(t *testing.T) {
+	config := &BuildConfig{Variables: map[string]string{}}
+
+	for _, name := range []string{"../../../../usr/bin/whatever", "..", "sub/dir", ""} {
+		var out bytes.Buffer
+		err := runPlugin(config, Target{}, "t", name, nil, &out)
+		if err == nil {
+			t.Fatalf("runPlugin(%q): expected error, got nil", name)
+		}
+		if !strings.Contains(err.Error(), "invalid plugin name") {
+			t.Fatalf("runPlugin(%q): expected invalid-name error, got %v", name, err)
+		}
+	}
+}
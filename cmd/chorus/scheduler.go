@@ -0,0 +1,235 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"sync"
+)
+
+// TargetState tracks where a target is in the scheduler's lifecycle.
+type TargetState int
+
+const (
+	Pending TargetState = iota
+	Running
+	Done
+	Failed
+)
+
+type targetResult struct {
+	done chan struct{}
+	err  error
+}
+
+// Scheduler builds the dependency DAG for the requested targets on the fly
+// and runs independent targets concurrently across a pool of -j workers.
+type Scheduler struct {
+	config *BuildConfig
+	sem    chan struct{}
+
+	// shard/shards restrict execution to a deterministic slice of the
+	// leaf/phony targets, letting a CI matrix split a big target's deps
+	// across machines with --shard N --shards M. shards of 1 (the
+	// default) disables filtering.
+	shard  int
+	shards int
+
+	// cache is the content-addressable build cache. A nil cache (set via
+	// --no-cache) disables it entirely.
+	cache *DirStore
+
+	// dryRun prints the expanded command sequence for each target instead
+	// of running it.
+	dryRun bool
+
+	// roots are the targets requested directly on the command line. They're
+	// exempt from shard filtering even when phony, so e.g. a "phony: true"
+	// "all" aggregator isn't itself skipped on some shards - only its
+	// leaf/phony dependencies are split across the shard matrix.
+	roots map[string]bool
+
+	mu      sync.Mutex
+	state   map[string]TargetState
+	results map[string]*targetResult
+
+	// reasons records each completed target's final RebuildReason, so a
+	// dependent can tell whether it needs to cascade a rebuild decision
+	// (see the dryRun branch in build). Only needed in --dry-run, where
+	// nothing actually executes and mtimes never change, but cheap enough
+	// to keep unconditionally.
+	reasons map[string]RebuildReason
+
+	printMu sync.Mutex
+}
+
+func newScheduler(config *BuildConfig, jobs int) *Scheduler {
+	if jobs < 1 {
+		jobs = 1
+	}
+	return &Scheduler{
+		config:  config,
+		sem:     make(chan struct{}, jobs),
+		shards:  1,
+		state:   make(map[string]TargetState),
+		results: make(map[string]*targetResult),
+		reasons: make(map[string]RebuildReason),
+	}
+}
+
+func (s *Scheduler) setState(target string, st TargetState) {
+	s.mu.Lock()
+	s.state[target] = st
+	s.mu.Unlock()
+}
+
+func (s *Scheduler) setReason(target string, r RebuildReason) {
+	s.mu.Lock()
+	s.reasons[target] = r
+	s.mu.Unlock()
+}
+
+func (s *Scheduler) reasonFor(target string) (RebuildReason, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	r, ok := s.reasons[target]
+	return r, ok
+}
+
+// run resolves target's dependencies (recursively, in parallel) and then
+// builds target itself. Concurrent callers asking for the same target share
+// a single build via the results map.
+func (s *Scheduler) run(target string) error {
+	s.mu.Lock()
+	if res, ok := s.results[target]; ok {
+		s.mu.Unlock()
+		<-res.done
+		return res.err
+	}
+	res := &targetResult{done: make(chan struct{})}
+	s.results[target] = res
+	s.state[target] = Pending
+	s.mu.Unlock()
+
+	res.err = s.build(target)
+	close(res.done)
+	return res.err
+}
+
+func (s *Scheduler) build(target string) error {
+	t, exists := s.config.Targets[target]
+	if !exists && target != "all" {
+		if pt, ok := resolvePattern(s.config, target); ok {
+			t, exists = pt, true
+		} else {
+			s.setState(target, Failed)
+			return fmt.Errorf("target '%s' not defined", target)
+		}
+	}
+
+	if len(t.Deps) > 0 {
+		var wg sync.WaitGroup
+		errs := make([]error, len(t.Deps))
+		for i, dep := range t.Deps {
+			wg.Add(1)
+			go func(i int, dep string) {
+				defer wg.Done()
+				errs[i] = s.run(dep)
+			}(i, dep)
+		}
+		wg.Wait()
+
+		for _, err := range errs {
+			if err != nil {
+				s.setState(target, Failed)
+				return err
+			}
+		}
+	}
+
+	if s.shards > 1 && !s.roots[target] && (len(t.Deps) == 0 || t.Phony) && !inShard(target, s.shard, s.shards) {
+		s.printMu.Lock()
+		printShardSkipped(target, s.shard, s.shards)
+		s.printMu.Unlock()
+		s.setState(target, Done)
+		return nil
+	}
+
+	s.sem <- struct{}{}
+	defer func() { <-s.sem }()
+
+	s.setState(target, Running)
+
+	// Commands run with the semaphore held but the print lock free, so
+	// -j independent targets genuinely execute in parallel. Output is
+	// buffered per-target and only flushed to stdout, under printMu, once
+	// the target finishes - that's what keeps colored progress lines from
+	// interleaving instead of serializing the work itself.
+	var out bytes.Buffer
+	var hit bool
+	var err error
+
+	reason := needsRebuild(s.config, target, t, s.cache)
+	if s.dryRun && reason == ReasonUpToDate {
+		// A real build would have already rebuilt a stale dep by now,
+		// giving it a fresh mtime that cascades into this target. Nothing
+		// actually executed here, so mtimes never moved - propagate the
+		// cascade explicitly instead of trusting this target's stale
+		// on-disk state in isolation.
+		for _, dep := range t.Deps {
+			if r, ok := s.reasonFor(dep); ok && r.rebuild() {
+				reason = ReasonDepRebuild
+				break
+			}
+		}
+	}
+	s.setReason(target, reason)
+
+	switch {
+	case reason == ReasonPhony:
+		err = executeCommands(s.config, t, target, &out, s.dryRun)
+	case reason.rebuild():
+		hit, err = s.buildOrRestore(target, t, &out)
+	}
+
+	s.printMu.Lock()
+	out.WriteTo(os.Stdout)
+	if err != nil {
+		s.printMu.Unlock()
+		s.setState(target, Failed)
+		return err
+	}
+
+	switch {
+	case reason == ReasonPhony, reason.rebuild():
+		if hit {
+			printCacheHit(target)
+		} else {
+			printSuccess(target)
+		}
+	default:
+		printSkipped(target)
+	}
+	s.printMu.Unlock()
+
+	s.setState(target, Done)
+	return nil
+}
+
+// buildOrRestore runs target's commands, or restores its output from the
+// cache when a prior build already produced the same content-addressed key.
+// It reports hit=true when the cache supplied the artifact.
+func (s *Scheduler) buildOrRestore(target string, t Target, out *bytes.Buffer) (bool, error) {
+	if s.dryRun || s.cache == nil {
+		return false, executeCommands(s.config, t, target, out, s.dryRun)
+	}
+
+	key, err := cacheKey(s.config, target, t)
+	if err != nil {
+		return false, executeCommands(s.config, t, target, out, s.dryRun)
+	}
+
+	return s.cache.GetOrCreate(key, target, func() error {
+		return executeCommands(s.config, t, target, out, s.dryRun)
+	})
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestSchedulerDryRunCascadesRebuild guards against the same chunk0-6 cascade
+// bug in the concurrent scheduler's --dry-run path: "final" depends on
+// "mid" depends on "src", with mid stale relative to src but final newer
+// than mid's current mtime. A real build would rebuild mid (giving it a
+// fresh mtime) and cascade into rebuilding final too; --dry-run must report
+// the same thing instead of reading final's stale on-disk mtime in
+// isolation and skipping it.
+func TestSchedulerDryRunCascadesRebuild(t *testing.T) {
+	dir := t.TempDir()
+	src := filepath.Join(dir, "src")
+	mid := filepath.Join(dir, "mid")
+	final := filepath.Join(dir, "final")
+
+	now := time.Now()
+	write := func(path string, mtime time.Time) {
+		if err := os.WriteFile(path, []byte("x"), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chtimes(path, mtime, mtime); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	write(src, now)
+	write(mid, now.Add(-time.Hour))
+	write(final, now.Add(time.Minute))
+
+	config := &BuildConfig{
+		Variables: map[string]string{},
+		Targets: map[string]Target{
+			final: {Deps: []string{mid}, Cmds: []string{"echo building final"}},
+			mid:   {Deps: []string{src}, Cmds: []string{"echo building mid"}},
+			src:   {},
+		},
+	}
+
+	sched := newScheduler(config, 1)
+	sched.dryRun = true
+
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatalf("os.Pipe: %v", err)
+	}
+	origStdout := os.Stdout
+	os.Stdout = w
+	runErr := sched.run(final)
+	w.Close()
+	os.Stdout = origStdout
+
+	var captured strings.Builder
+	io.Copy(&captured, r)
+
+	if runErr != nil {
+		t.Fatalf("unexpected error: %v", runErr)
+	}
+	if !strings.Contains(captured.String(), "building final") {
+		t.Fatalf("expected dry-run to print final's commands (cascaded rebuild), got: %s", captured.String())
+	}
+}
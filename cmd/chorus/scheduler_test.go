@@ -0,0 +1,45 @@
+package main
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+// TestSchedulerRunsIndependentDepsConcurrently guards against the scheduler
+// regressing into fully-serialized execution (see chunk0-1 review): "all"
+// depends on two independent phony targets that each block until both have
+// started, so a scheduler that runs deps one at a time deadlocks here.
+func TestSchedulerRunsIndependentDepsConcurrently(t *testing.T) {
+	var wg sync.WaitGroup
+	wg.Add(2)
+
+	RegisterInternal("test_barrier", func(args []string) error {
+		wg.Done()
+		wg.Wait()
+		return nil
+	})
+
+	config := &BuildConfig{
+		Variables: map[string]string{},
+		Targets: map[string]Target{
+			"all": {Phony: true, Deps: []string{"a", "b"}},
+			"a":   {Phony: true, Cmds: []string{"internal:test_barrier"}},
+			"b":   {Phony: true, Cmds: []string{"internal:test_barrier"}},
+		},
+	}
+
+	sched := newScheduler(config, 2)
+
+	errCh := make(chan error, 1)
+	go func() { errCh <- sched.run("all") }()
+
+	select {
+	case err := <-errCh:
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("deadlock: independent deps did not run concurrently")
+	}
+}
@@ -0,0 +1,23 @@
+package main
+
+import (
+	"fmt"
+	"hash/fnv"
+)
+
+// inShard reports whether target belongs to the given shard out of shards
+// total, using an FNV-1a hash of its name so the assignment is deterministic
+// across machines without any coordination.
+func inShard(target string, shard, shards int) bool {
+	h := fnv.New32a()
+	h.Write([]byte(target))
+	return int(h.Sum32()%uint32(shards)) == shard
+}
+
+func printShardSkipped(target string, shard, shards int) {
+	fmt.Printf("%s %s %s\n\n",
+		yellow("ⓘ"),
+		bold("Skipping"),
+		cyan(target)+yellow(fmt.Sprintf(" (not in shard %d/%d)", shard, shards)),
+	)
+}